@@ -2,24 +2,44 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"mytcpchat/internal/proto"
 )
 
 const serverAddr = "127.0.0.1:3000"
 
+var (
+	useTLS        = flag.Bool("tls", false, "connect using TLS")
+	insecureTLS   = flag.Bool("insecure", false, "skip TLS certificate verification")
+	keyFile       = flag.String("key", "", "SSH private key file used to answer /pubkeyauth challenges")
+	pubkeyAuthFor = flag.String("pubkeyauth", "", "name to authenticate as via /pubkeyauth once connected")
+	legacy        = flag.Bool("legacy", false, "speak the legacy newline-delimited protocol instead of framed proto")
+)
+
+var seq atomic.Uint64
+
 func main() {
+	flag.Parse()
 	// allow optional single message argument
 	var initialMsg string
-	if len(os.Args) >= 2 {
-		initialMsg = strings.Join(os.Args[1:], " ")
+	if flag.NArg() >= 1 {
+		initialMsg = strings.Join(flag.Args(), " ")
 	}
 
 	fmt.Printf("Trying to connect to %s...\n", serverAddr)
-	conn, err := net.DialTimeout("tcp", serverAddr, 5*time.Second)
+	conn, err := dial()
 	if err != nil {
 		fmt.Println("Connection error:", err)
 		return
@@ -27,15 +47,15 @@ func main() {
 	defer conn.Close()
 	fmt.Println("Connected!")
 
-	// goroutine to read server messages continuously
-	go func() {
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			fmt.Println("Received:", scanner.Text())
-		}
-		fmt.Println("Server connection closed.")
-		os.Exit(0)
-	}()
+	if *pubkeyAuthFor != "" {
+		sendCommand(conn, "pubkeyauth", []string{*pubkeyAuthFor})
+	}
+
+	if *legacy {
+		go readLegacy(conn)
+	} else {
+		go readFramed(conn)
+	}
 
 	// if initialMsg provided, send it once
 	if initialMsg != "" {
@@ -63,9 +83,139 @@ func main() {
 	}
 }
 
-func sendLine(conn net.Conn, s string) {
-	_, err := conn.Write([]byte(s + "\n"))
-	if err != nil {
+func dial() (net.Conn, error) {
+	if !*useTLS {
+		return net.DialTimeout("tcp", serverAddr, 5*time.Second)
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", serverAddr, &tls.Config{InsecureSkipVerify: *insecureTLS})
+}
+
+// commandArgLimits caps how many arguments sendLine splits a command's
+// tail into for commands whose last argument is free text that may itself
+// contain spaces (e.g. a password). Tokens beyond the limit are rejoined
+// into the final argument instead of becoming extra arguments. Commands
+// not listed here are split on every whitespace run, as before.
+var commandArgLimits = map[string]int{
+	"setname": 2, // name password
+	"connect": 2, // name password
+}
+
+// splitArgs tokenizes a command's argument line, honoring commandArgLimits
+// so a multi-word password or similar trailing field survives as one
+// argument instead of being torn apart on its embedded spaces.
+func splitArgs(name, argLine string) []string {
+	fields := strings.Fields(argLine)
+	limit, ok := commandArgLimits[name]
+	if !ok || len(fields) <= limit {
+		return fields
+	}
+	args := append([]string{}, fields[:limit-1]...)
+	return append(args, strings.Join(fields[limit-1:], " "))
+}
+
+// sendLine sends a line of user input: a command if it starts with "/", an
+// ordinary chat message otherwise.
+func sendLine(conn net.Conn, line string) {
+	if strings.HasPrefix(line, "/") {
+		rest := strings.TrimPrefix(line, "/")
+		name, argLine, _ := strings.Cut(rest, " ")
+		sendCommand(conn, name, splitArgs(name, argLine))
+		return
+	}
+	if *legacy {
+		writeLegacy(conn, line)
+		return
+	}
+	if err := proto.WriteFrame(conn, proto.NewMsg(seq.Add(1), line)); err != nil {
 		fmt.Println("send error:", err)
 	}
 }
+
+func sendCommand(conn net.Conn, name string, args []string) {
+	if *legacy {
+		writeLegacy(conn, "/"+strings.Join(append([]string{name}, args...), " "))
+		return
+	}
+	if err := proto.WriteFrame(conn, proto.NewCmd(seq.Add(1), name, args)); err != nil {
+		fmt.Println("send error:", err)
+	}
+}
+
+func writeLegacy(conn net.Conn, s string) {
+	if _, err := conn.Write([]byte(s + "\n")); err != nil {
+		fmt.Println("send error:", err)
+	}
+}
+
+func readLegacy(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Println("Received:", line)
+		if strings.HasPrefix(line, "AUTH ") {
+			handleAuthChallenge(conn, strings.TrimPrefix(line, "AUTH "))
+		}
+	}
+	fmt.Println("Server connection closed.")
+	os.Exit(0)
+}
+
+func readFramed(conn net.Conn) {
+	for {
+		frame, err := proto.ReadFrame(conn)
+		if err != nil {
+			fmt.Println("Server connection closed.")
+			os.Exit(0)
+		}
+		switch frame.Type {
+		case proto.Reply:
+			p, _ := frame.DecodeReply()
+			fmt.Println("Received:", p.Text)
+			if strings.HasPrefix(p.Text, "AUTH ") {
+				handleAuthChallenge(conn, strings.TrimPrefix(p.Text, "AUTH "))
+			}
+		case proto.Event:
+			p, _ := frame.DecodeEvent()
+			fmt.Println("Received:", p.Text)
+			if strings.HasPrefix(p.Text, "AUTH ") {
+				handleAuthChallenge(conn, strings.TrimPrefix(p.Text, "AUTH "))
+			}
+		case proto.Error:
+			p, _ := frame.DecodeError()
+			fmt.Println("ERR:", p.Message)
+		default:
+			fmt.Printf("Received unknown frame type %q\n", frame.Type)
+		}
+	}
+}
+
+// handleAuthChallenge signs a /pubkeyauth nonce with -key and replies with
+// /authresp, completing the challenge/response started by the server.
+func handleAuthChallenge(conn net.Conn, nonceB64 string) {
+	if *keyFile == "" {
+		fmt.Println("received AUTH challenge but no -key configured, ignoring")
+		return
+	}
+	nonce, err := base64.StdEncoding.DecodeString(nonceB64)
+	if err != nil {
+		fmt.Println("invalid nonce from server:", err)
+		return
+	}
+	keyBytes, err := os.ReadFile(*keyFile)
+	if err != nil {
+		fmt.Println("read key file error:", err)
+		return
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		fmt.Println("parse key error:", err)
+		return
+	}
+	sig, err := signer.Sign(rand.Reader, nonce)
+	if err != nil {
+		fmt.Println("sign error:", err)
+		return
+	}
+	sendCommand(conn, "authresp", []string{sig.Format, base64.StdEncoding.EncodeToString(sig.Blob)})
+}
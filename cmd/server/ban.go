@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// banKinds enumerates the supported Ban.Type values.
+var banKinds = map[string]bool{"name": true, "ip": true, "userid": true}
+
+// Ban is a moderation entry blocking a name, IP address or user id, either
+// permanently (zero Until) or until a point in time.
+type Ban struct {
+	ID        uint `gorm:"primaryKey"`
+	Type      string
+	Value     string
+	Until     time.Time
+	Reason    string
+	CreatedAt time.Time
+}
+
+func (b Ban) expired() bool {
+	return !b.Until.IsZero() && time.Now().After(b.Until)
+}
+
+// BanCache mirrors the Ban table in memory so handleConn can check every
+// connection and message without hitting the database. It is reloaded in
+// full whenever a ban is added or removed.
+type BanCache struct {
+	mu      sync.RWMutex
+	byValue map[string]map[string]time.Time // type -> value -> until (zero = permanent)
+}
+
+func NewBanCache() *BanCache {
+	return &BanCache{byValue: make(map[string]map[string]time.Time)}
+}
+
+// Reload replaces the cache contents with the current Ban table, lazily
+// deleting any rows that have since expired so they don't accumulate
+// forever in the database.
+func (bc *BanCache) Reload() error {
+	var bans []Ban
+	if err := db.Find(&bans).Error; err != nil {
+		return err
+	}
+	fresh := make(map[string]map[string]time.Time, len(banKinds))
+	for kind := range banKinds {
+		fresh[kind] = make(map[string]time.Time)
+	}
+	var expiredIDs []uint
+	for _, b := range bans {
+		if b.expired() {
+			expiredIDs = append(expiredIDs, b.ID)
+			continue
+		}
+		fresh[b.Type][b.Value] = b.Until
+	}
+	if len(expiredIDs) > 0 {
+		if err := db.Delete(&Ban{}, expiredIDs).Error; err != nil {
+			fmt.Println("prune expired bans error:", err)
+		}
+	}
+	bc.mu.Lock()
+	bc.byValue = fresh
+	bc.mu.Unlock()
+	return nil
+}
+
+// Banned reports whether kind/value is currently banned, lazily dropping
+// the entry from the cache once it has expired.
+func (bc *BanCache) Banned(kind, value string) bool {
+	bc.mu.RLock()
+	until, ok := bc.byValue[kind][value]
+	bc.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && time.Now().After(until) {
+		bc.mu.Lock()
+		delete(bc.byValue[kind], value)
+		bc.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// clientBanned checks whether the given client is currently banned by IP, name or
+// user id.
+func clientBanned(bc *BanCache, c *Client) bool {
+	host, _, _ := net.SplitHostPort(c.remote)
+	if host != "" && bc.Banned("ip", host) {
+		return true
+	}
+	if c.user != nil {
+		if bc.Banned("userid", strconv.FormatUint(uint64(c.user.ID), 10)) {
+			return true
+		}
+		if bc.Banned("name", c.user.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func requireAdmin(c *Client) error {
+	if c.user == nil || !c.user.Admin {
+		return fmt.Errorf("admin privileges required")
+	}
+	return nil
+}
+
+// parseBanUntil turns a /ban duration argument ("10m", "2h30m", "0" or
+// "permanent") into an absolute expiry time. A zero result means no expiry.
+func parseBanUntil(arg string) (time.Time, error) {
+	if arg == "0" || arg == "permanent" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid duration %q: %w", arg, err)
+	}
+	return time.Now().Add(d), nil
+}
+
+func formatBan(b Ban) string {
+	until := "permanent"
+	if !b.Until.IsZero() {
+		until = b.Until.Format(timeLayout)
+	}
+	if b.Reason != "" {
+		return fmt.Sprintf("%s %s until %s (%s)", b.Type, b.Value, until, b.Reason)
+	}
+	return fmt.Sprintf("%s %s until %s", b.Type, b.Value, until)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"mytcpchat/internal/proto"
+)
+
+// outboundBuffer bounds how many pending lines a single slow client can
+// accumulate before the hub starts dropping messages to it rather than
+// blocking the broadcaster.
+const outboundBuffer = 16
+
+// Client represents one connected TCP session. It is registered with the
+// Hub for the lifetime of the connection so other clients can broadcast or
+// address it directly.
+type Client struct {
+	conn     net.Conn
+	remote   string
+	user     *User
+	room     string
+	outbound chan []byte
+
+	// legacy is true when this connection speaks the original
+	// newline-delimited protocol rather than the framed proto.
+	legacy bool
+
+	// msgLimiter throttles how many lines/frames per second this
+	// connection may send; excess input is dropped with an ERR reply.
+	msgLimiter *rate.Limiter
+
+	// pendingNonce/pendingAuthName track an in-flight /pubkeyauth challenge
+	// issued to this connection.
+	pendingNonce    []byte
+	pendingAuthName string
+}
+
+func newClient(conn net.Conn, legacy bool, msgLimiter *rate.Limiter) *Client {
+	return &Client{
+		conn:       conn,
+		remote:     conn.RemoteAddr().String(),
+		outbound:   make(chan []byte, outboundBuffer),
+		legacy:     legacy,
+		msgLimiter: msgLimiter,
+	}
+}
+
+// displayName returns the client's logged-in name, falling back to its
+// remote address for anonymous connections.
+func (c *Client) displayName() string {
+	if c.user != nil {
+		return c.user.Name
+	}
+	return c.remote
+}
+
+// send enqueues an event line for the client's writer goroutine, encoding
+// it as a framed Event for proto clients or a raw line for legacy ones. It
+// never blocks: if the client's outbound buffer is full, the line is
+// dropped rather than stalling the sender or other room members.
+func (c *Client) send(line string) {
+	var buf []byte
+	if c.legacy {
+		buf = []byte(line + "\n")
+	} else {
+		encoded, err := proto.Encode(proto.NewEvent(0, line))
+		if err != nil {
+			fmt.Println("encode event error:", err)
+			return
+		}
+		buf = encoded
+	}
+	select {
+	case c.outbound <- buf:
+	default:
+		fmt.Println("dropping message to slow client", c.remote)
+	}
+}
+
+// Hub is the central registry of active connections, rooms and room
+// membership. All methods are safe for concurrent use.
+type Hub struct {
+	mu            sync.Mutex
+	clientsByAddr map[string]*Client
+	clientsByName map[string]*Client
+	rooms         map[string]map[*Client]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clientsByAddr: make(map[string]*Client),
+		clientsByName: make(map[string]*Client),
+		rooms:         make(map[string]map[*Client]bool),
+	}
+}
+
+// Register adds a newly accepted connection to the hub, keyed by remote
+// address. It is not associated with a user or room yet.
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clientsByAddr[c.remote] = c
+}
+
+// Unregister removes a client from the hub entirely, dropping it from its
+// room and name index, then closes its outbound channel to stop the writer
+// goroutine.
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(c)
+	delete(h.clientsByAddr, c.remote)
+	if c.user != nil {
+		delete(h.clientsByName, c.user.Name)
+	}
+	close(c.outbound)
+}
+
+// BindUser associates an authenticated user with a connection, keying it by
+// user name so /msg can address it. There is no index by user id.
+func (h *Hub) BindUser(c *Client, u *User) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.user = u
+	h.clientsByName[u.Name] = c
+}
+
+// Join moves a client into room, leaving any room it previously occupied.
+func (h *Hub) Join(c *Client, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(c)
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[*Client]bool)
+		h.rooms[room] = members
+	}
+	members[c] = true
+	c.room = room
+}
+
+// Leave removes a client from its current room, if any.
+func (h *Hub) Leave(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.leaveLocked(c)
+}
+
+func (h *Hub) leaveLocked(c *Client) {
+	if c.room == "" {
+		return
+	}
+	if members, ok := h.rooms[c.room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, c.room)
+		}
+	}
+	c.room = ""
+}
+
+// Broadcast sends line to every member of room except exclude.
+func (h *Hub) Broadcast(room, line string, exclude *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for member := range h.rooms[room] {
+		if member == exclude {
+			continue
+		}
+		member.send(line)
+	}
+}
+
+// RoomCounts returns the number of members in every non-empty room.
+func (h *Hub) RoomCounts() map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make(map[string]int, len(h.rooms))
+	for room, members := range h.rooms {
+		counts[room] = len(members)
+	}
+	return counts
+}
+
+// FindByName returns the client currently logged in as name, if any.
+func (h *Hub) FindByName(name string) (*Client, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.clientsByName[name]
+	return c, ok
+}
+
+// SendTo delivers line to the client currently logged in as name, doing the
+// lookup and send under the same lock so a concurrent Unregister cannot
+// close the target's outbound channel in between (unlike FindByName
+// followed by a separate send, this cannot race with disconnect). Reports
+// whether name was found online.
+func (h *Hub) SendTo(name, line string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.clientsByName[name]
+	if !ok {
+		return false
+	}
+	c.send(line)
+	return true
+}
+
+// MatchingClients returns the connected clients a ban of the given kind and
+// value would apply to, so it can be enforced immediately.
+func (h *Hub) MatchingClients(kind, value string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []*Client
+	switch kind {
+	case "ip":
+		for addr, c := range h.clientsByAddr {
+			if host, _, err := net.SplitHostPort(addr); err == nil && host == value {
+				out = append(out, c)
+			}
+		}
+	case "name":
+		if c, ok := h.clientsByName[value]; ok {
+			out = append(out, c)
+		}
+	case "userid":
+		for _, c := range h.clientsByName {
+			if c.user != nil && fmt.Sprint(c.user.ID) == value {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+func chatLine(name, text string) string {
+	return fmt.Sprintf("%s %s: %s", time.Now().Format(timeLayout), name, text)
+}
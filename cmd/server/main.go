@@ -2,17 +2,22 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"mytcpchat/internal/proto"
 )
 
 const (
@@ -21,10 +26,25 @@ const (
 	timeLayout = "15:04"
 )
 
+var (
+	adminFlag     = flag.String("admin", "", "name or key fingerprint of an existing user to promote to admin on startup")
+	tlsCertFlag   = flag.String("tls-cert", "", "TLS certificate file (enables TLS when set with -tls-key)")
+	tlsKeyFlag    = flag.String("tls-key", "", "TLS private key file (enables TLS when set with -tls-cert)")
+	whitelistFlag = flag.String("whitelist", "", "file of names/key fingerprints allowed to log in (default: allow all)")
+	legacyFlag    = flag.Bool("legacy", false, "speak the legacy newline-delimited protocol instead of framed proto")
+	metricsAddr   = flag.String("metrics-addr", "", "listen address for /metrics and /debug/pprof (disabled if empty)")
+	maxConnsPerIP = flag.Int("max-conns-per-ip", 10, "maximum concurrent connections allowed from a single IP (0 = unlimited)")
+	msgRateFlag   = flag.Float64("msg-rate", 5, "maximum chat messages/commands per second a connection may send")
+	msgBurstFlag  = flag.Int("msg-burst", 10, "token bucket burst size for -msg-rate")
+	maxAuthFails  = flag.Int("max-auth-fails", 5, "consecutive failed /connect or /authresp attempts from an IP before it is temporarily banned (0 = disabled)")
+	authBanFor    = flag.Duration("auth-ban-for", 15*time.Minute, "how long an IP is banned for tripping -max-auth-fails")
+)
+
 type User struct {
 	ID        uint `gorm:"primaryKey"`
 	Name      string `gorm:"uniqueIndex"`
 	Password  string
+	Admin     bool
 	CreatedAt time.Time
 }
 
@@ -33,18 +53,21 @@ type Message struct {
 	UserID    *uint
 	UserName  string
 	Addr      string
+	Room      string `gorm:"index"`
 	Text      string
 	CreatedAt time.Time
 }
 
 var (
-	db *gorm.DB
-	historyMutex sync.Mutex
-	// in-memory history cached for quick send on connect (keeps last N or all)
+	db          *gorm.DB
+	banCache    = NewBanCache()
+	allowed     whitelist
+	rateLimiter *connLimiter
 )
 
 func main() {
 	var err error
+	flag.Parse()
 	fmt.Println("Starting server on", addr)
 
 	db, err = gorm.Open(sqlite.Open(dbFile), &gorm.Config{})
@@ -53,48 +76,123 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := db.AutoMigrate(&User{}, &Message{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &Message{}, &Ban{}, &PubKey{}); err != nil {
 		fmt.Println("migrate error:", err)
 		os.Exit(1)
 	}
 
-	ln, err := net.Listen("tcp", addr)
+	if err := registerGormMetrics(db); err != nil {
+		fmt.Println("metrics callback registration error:", err)
+		os.Exit(1)
+	}
+
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr)
+	}
+
+	if *adminFlag != "" {
+		res := db.Model(&User{}).Where("name = ?", *adminFlag).Update("admin", true)
+		if res.Error != nil {
+			fmt.Println("admin bootstrap error:", res.Error)
+		} else if res.RowsAffected == 0 {
+			if err := db.Exec("UPDATE users SET admin = ? WHERE id = (SELECT user_id FROM pub_keys WHERE fingerprint = ?)", true, *adminFlag).Error; err != nil {
+				fmt.Println("admin bootstrap error:", err)
+			}
+		}
+	}
+
+	allowed, err = loadWhitelist(*whitelistFlag)
 	if err != nil {
-		fmt.Println("listen error:", err)
+		fmt.Println("whitelist load error:", err)
+		os.Exit(1)
+	}
+
+	if err := banCache.Reload(); err != nil {
+		fmt.Println("ban cache load error:", err)
+	}
+
+	rateLimiter = newConnLimiter(*maxConnsPerIP, *msgRateFlag, *msgBurstFlag, *maxAuthFails, *authBanFor)
+
+	var ln net.Listener
+	var lnErr error
+	if *tlsCertFlag != "" || *tlsKeyFlag != "" {
+		cert, certErr := tls.LoadX509KeyPair(*tlsCertFlag, *tlsKeyFlag)
+		if certErr != nil {
+			fmt.Println("tls cert error:", certErr)
+			os.Exit(1)
+		}
+		ln, lnErr = tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	} else {
+		ln, lnErr = net.Listen("tcp", addr)
+	}
+	if lnErr != nil {
+		fmt.Println("listen error:", lnErr)
 		os.Exit(1)
 	}
 	defer ln.Close()
 
+	hub := NewHub()
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			fmt.Println("accept error:", err)
 			continue
 		}
-		go handleConn(conn)
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if host != "" && banCache.Banned("ip", host) {
+			conn.Write([]byte("ERR: banned\n"))
+			conn.Close()
+			continue
+		}
+		if host != "" && !rateLimiter.acquire(host) {
+			conn.Write([]byte("ERR: too many connections from your address\n"))
+			conn.Close()
+			continue
+		}
+		go handleConn(hub, conn)
 	}
 }
 
-func handleConn(conn net.Conn) {
+func handleConn(hub *Hub, conn net.Conn) {
 	defer conn.Close()
-	remote := conn.RemoteAddr().String()
+	c := newClient(conn, *legacyFlag, rateLimiter.newMessageLimiter())
 	now := time.Now().Format(timeLayout)
-	fmt.Printf("%s Client connected from %s\n", now, remote)
+	fmt.Printf("%s Client connected from %s\n", now, c.remote)
 
-	// Send history to new client (from DB)
-	if err := sendHistory(conn); err != nil {
-		fmt.Println("error sending history:", err)
+	if host, _, _ := net.SplitHostPort(c.remote); host != "" {
+		defer rateLimiter.release(host)
 	}
 
-	reader := bufio.NewReader(conn)
+	hub.Register(c)
+	defer hub.Unregister(c)
 
-	// track current user if connected
-	var currentUser *User
+	connectedClients.Inc()
+	defer connectedClients.Dec()
+
+	go func() {
+		for buf := range c.outbound {
+			if _, err := conn.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	if c.legacy {
+		handleConnLegacy(hub, c)
+	} else {
+		handleConnFramed(hub, c)
+	}
+}
+
+func handleConnLegacy(hub *Hub, c *Client) {
+	conn := c.conn
+	reader := bufio.NewReader(conn)
 
 	for {
 		line, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Printf("%s Client %s disconnected\n", time.Now().Format(timeLayout), remote)
+			fmt.Printf("%s Client %s disconnected\n", time.Now().Format(timeLayout), c.remote)
 			return
 		}
 		line = strings.TrimSpace(line)
@@ -102,9 +200,21 @@ func handleConn(conn net.Conn) {
 			continue
 		}
 
+		if clientBanned(banCache, c) {
+			conn.Write([]byte("ERR: banned\n"))
+			return
+		}
+
+		if !c.msgLimiter.Allow() {
+			conn.Write([]byte("ERR: rate limit\n"))
+			continue
+		}
+
 		// Handle commands starting with /
 		if strings.HasPrefix(line, "/") {
-			resp, err := handleCommand(line, &currentUser, remote)
+			parts := strings.Fields(line)
+			cmd := strings.TrimPrefix(parts[0], "/")
+			resp, err := handleCommand(hub, c, cmd, parts[1:])
 			if err != nil {
 				conn.Write([]byte("ERR: " + err.Error() + "\n"))
 			} else if resp != "" {
@@ -113,96 +223,104 @@ func handleConn(conn net.Conn) {
 			continue
 		}
 
-		// Not a command - process parsing tasks and store message
-		// Save message to DB
-		msg := Message{
-			Text: line,
-			Addr: remote,
-			CreatedAt: time.Now(),
+		// Ordinary line: broadcast to the sender's current room.
+		if c.room == "" {
+			conn.Write([]byte("ERR: join a room first with /join <room>\n"))
+			continue
 		}
-		if currentUser != nil {
-			msg.UserID = &currentUser.ID
-			msg.UserName = currentUser.Name
+		storeAndBroadcast(hub, c, line)
+	}
+}
+
+func handleConnFramed(hub *Hub, c *Client) {
+	conn := c.conn
+
+	for {
+		frame, err := proto.ReadFrame(conn)
+		if err != nil {
+			fmt.Printf("%s Client %s disconnected\n", time.Now().Format(timeLayout), c.remote)
+			return
 		}
-		if err := db.Create(&msg).Error; err != nil {
-			fmt.Println("db create message error:", err)
+
+		if clientBanned(banCache, c) {
+			writeFrame(conn, proto.NewError(frame.Seq, "banned"))
+			return
 		}
 
-		// Log
-		nameOrAddr := remote
-		if currentUser != nil {
-			nameOrAddr = currentUser.Name
+		if !c.msgLimiter.Allow() {
+			writeFrame(conn, proto.NewError(frame.Seq, "rate limit"))
+			continue
 		}
-		logEntry := fmt.Sprintf("%s %s %s", time.Now().Format(timeLayout), nameOrAddr, line)
-		fmt.Println(logEntry)
 
-		// Respond according to parsing rules:
-		// If message starts with "echo/add/mul" treat specially (as per 4.3.3)
-		tokens := strings.Fields(line)
-		var reply string
-		switch tokens[0] {
-		case "echo":
-			if len(tokens) >= 2 {
-				reply = strings.Join(tokens[1:], " ")
-			} else {
-				reply = ""
+		switch frame.Type {
+		case proto.Cmd:
+			payload, err := frame.DecodeCmd()
+			if err != nil {
+				writeFrame(conn, proto.NewError(frame.Seq, "malformed command frame"))
+				continue
 			}
-		case "add":
-			if len(tokens) == 3 {
-				a, b := tokens[1], tokens[2]
-				var ai, bi int
-				_, err1 := fmt.Sscanf(a, "%d", &ai)
-				_, err2 := fmt.Sscanf(b, "%d", &bi)
-				if err1==nil && err2==nil {
-					reply = fmt.Sprintf("%d", ai+bi)
-				} else {
-					reply = "ERR: add expects two integers"
-				}
-			} else {
-				reply = "ERR: add expects two arguments"
+			resp, err := handleCommand(hub, c, payload.Name, payload.Args)
+			if err != nil {
+				writeFrame(conn, proto.NewError(frame.Seq, err.Error()))
+			} else if resp != "" {
+				writeFrame(conn, proto.NewReply(frame.Seq, resp))
 			}
-		case "mul":
-			if len(tokens) == 3 {
-				a, b := tokens[1], tokens[2]
-				var ai, bi int
-				_, err1 := fmt.Sscanf(a, "%d", &ai)
-				_, err2 := fmt.Sscanf(b, "%d", &bi)
-				if err1==nil && err2==nil {
-					reply = fmt.Sprintf("%d", ai*bi)
-				} else {
-					reply = "ERR: mul expects two integers"
-				}
-			} else {
-				reply = "ERR: mul expects two arguments"
+		case proto.Msg:
+			payload, err := frame.DecodeMsg()
+			if err != nil {
+				writeFrame(conn, proto.NewError(frame.Seq, "malformed message frame"))
+				continue
 			}
-		default:
-			// other parsing commands from 4.3
-			// bytes -> number of bytes in message
-			// words -> number of words
-			// fallback: echo back original + " from server"
-			if strings.HasPrefix(line, "bytes ") {
-				rest := strings.TrimPrefix(line, "bytes ")
-				reply = fmt.Sprintf("%d", len([]byte(rest)))
-			} else if strings.HasPrefix(line, "words ") {
-				rest := strings.TrimPrefix(line, "words ")
-				reply = fmt.Sprintf("%d", len(strings.Fields(rest)))
-			} else {
-				reply = line + " from server"
+			if c.room == "" {
+				writeFrame(conn, proto.NewError(frame.Seq, "join a room first with /join <room>"))
+				continue
 			}
+			storeAndBroadcast(hub, c, payload.Text)
+		default:
+			writeFrame(conn, proto.NewError(frame.Seq, "unsupported frame type: "+string(frame.Type)))
 		}
+	}
+}
 
-		// send reply
-		_, err = conn.Write([]byte(reply + "\n"))
-		if err != nil {
-			fmt.Println("write error:", err)
-			return
-		}
+// writeFrame writes f to conn, logging (rather than propagating) any error
+// since the caller is already inside a read loop driven by conn itself.
+func writeFrame(conn net.Conn, f proto.Frame) {
+	if err := proto.WriteFrame(conn, f); err != nil {
+		fmt.Println("write frame error:", err)
 	}
 }
 
-func sendHistory(conn net.Conn) error {
+// storeAndBroadcast saves an ordinary chat line from c and fans it out to
+// every member of c's current room, c included. Shared by the legacy and
+// framed read loops.
+func storeAndBroadcast(hub *Hub, c *Client, text string) {
+	msg := Message{
+		Text:      text,
+		Addr:      c.remote,
+		Room:      c.room,
+		CreatedAt: time.Now(),
+	}
+	if c.user != nil {
+		msg.UserID = &c.user.ID
+		msg.UserName = c.user.Name
+	}
+	start := time.Now()
+	err := db.Create(&msg).Error
+	dbWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		fmt.Println("db create message error:", err)
+	}
+
+	messagesTotal.Inc()
+	fmt.Printf("%s [%s] %s: %s\n", time.Now().Format(timeLayout), c.room, c.displayName(), text)
+	hub.Broadcast(c.room, chatLine(c.displayName(), text), nil)
+}
+
+// sendRoomHistory replays stored messages for room to c, in order, on
+// /join, using whichever wire format c speaks.
+func sendRoomHistory(c *Client, room string) error {
 	var msgs []Message
-	if err := db.Order("created_at asc").Find(&msgs).Error; err != nil {
+	if err := db.Where("room = ?", room).Order("created_at asc").Find(&msgs).Error; err != nil {
 		return err
 	}
 	for _, m := range msgs {
@@ -210,17 +328,35 @@ func sendHistory(conn net.Conn) error {
 		if m.UserName != "" {
 			displayName = m.UserName
 		}
-		line := fmt.Sprintf("%s %s %s\n", m.CreatedAt.Format(timeLayout), displayName, m.Text)
-		if _, err := conn.Write([]byte(line)); err != nil {
+		line := fmt.Sprintf("%s %s %s", m.CreatedAt.Format(timeLayout), displayName, m.Text)
+		if c.legacy {
+			if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+				return err
+			}
+		} else if err := proto.WriteFrame(c.conn, proto.NewEvent(0, line)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func handleCommand(line string, currentUser **User, remote string) (string, error) {
-	parts := strings.Fields(line)
-	cmd := strings.TrimPrefix(parts[0], "/")
+// knownCommands enumerates the command names handleCommand dispatches on,
+// used to keep chat_commands_total from growing an unbounded label series
+// when a client sends garbage command names.
+var knownCommands = map[string]bool{
+	"setname": true, "connect": true, "list": true, "join": true,
+	"leave": true, "rooms": true, "msg": true, "addkey": true,
+	"pubkeyauth": true, "authresp": true, "ban": true, "unban": true,
+	"kick": true, "banlist": true,
+}
+
+func handleCommand(hub *Hub, c *Client, cmd string, args []string) (string, error) {
+	if knownCommands[cmd] {
+		commandsTotal.WithLabelValues(cmd).Inc()
+	} else {
+		commandsTotal.WithLabelValues("unknown").Inc()
+	}
+	parts := append([]string{"/" + cmd}, args...)
 	switch cmd {
 	case "setname":
 		// /setname name password
@@ -234,16 +370,26 @@ func handleCommand(line string, currentUser **User, remote string) (string, erro
 		if err := db.Where("name = ?", name).First(&exists).Error; err == nil {
 			return "", errors.New("name already taken")
 		}
+		if banCache.Banned("name", name) {
+			return "", errors.New("that name is banned")
+		}
+		if !allowed.allows(name, "") {
+			return "", errors.New("not on the whitelist")
+		}
 		// hash password
 		h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 		if err != nil {
 			return "", err
 		}
-		u := User{Name: name, Password: string(h), CreatedAt: time.Now()}
+		var userCount int64
+		if err := db.Model(&User{}).Count(&userCount).Error; err != nil {
+			return "", err
+		}
+		u := User{Name: name, Password: string(h), Admin: userCount == 0, CreatedAt: time.Now()}
 		if err := db.Create(&u).Error; err != nil {
 			return "", err
 		}
-		*currentUser = &u
+		hub.BindUser(c, &u)
 		return "OK: registered and logged in as " + name, nil
 	case "connect":
 		// /connect name password
@@ -252,14 +398,26 @@ func handleCommand(line string, currentUser **User, remote string) (string, erro
 		}
 		name := parts[1]
 		pw := parts[2]
+		host, _, _ := net.SplitHostPort(c.remote)
 		var u User
 		if err := db.Where("name = ?", name).First(&u).Error; err != nil {
+			recordAuthFailure(hub, host)
 			return "", errors.New("no such user")
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(pw)); err != nil {
+			recordAuthFailure(hub, host)
 			return "", errors.New("invalid password")
 		}
-		*currentUser = &u
+		if banCache.Banned("name", u.Name) || banCache.Banned("userid", strconv.FormatUint(uint64(u.ID), 10)) {
+			recordAuthFailure(hub, host)
+			return "", errors.New("this account is banned")
+		}
+		if !allowed.allows(u.Name, "") {
+			recordAuthFailure(hub, host)
+			return "", errors.New("not on the whitelist")
+		}
+		rateLimiter.authSuccess(host)
+		hub.BindUser(c, &u)
 		return "OK: logged in as " + name, nil
 	case "list":
 		// list all users except current
@@ -269,7 +427,7 @@ func handleCommand(line string, currentUser **User, remote string) (string, erro
 		}
 		var out []string
 		for _, u := range users {
-			if *currentUser != nil && u.ID == (*currentUser).ID {
+			if c.user != nil && u.ID == c.user.ID {
 				continue
 			}
 			out = append(out, u.Name)
@@ -278,6 +436,190 @@ func handleCommand(line string, currentUser **User, remote string) (string, erro
 			return "(no other users)", nil
 		}
 		return strings.Join(out, ", "), nil
+	case "join":
+		// /join <room>
+		if len(parts) != 2 {
+			return "", errors.New("usage: /join <room>")
+		}
+		room := parts[1]
+		if c.room == room {
+			return "OK: already in " + room, nil
+		}
+		prevRoom := c.room
+		hub.Join(c, room)
+		if prevRoom != "" {
+			hub.Broadcast(prevRoom, fmt.Sprintf("* %s left %s", c.displayName(), prevRoom), c)
+		}
+		if err := sendRoomHistory(c, room); err != nil {
+			fmt.Println("error sending room history:", err)
+		}
+		hub.Broadcast(room, fmt.Sprintf("* %s joined %s", c.displayName(), room), c)
+		return "OK: joined " + room, nil
+	case "leave":
+		// /leave
+		if c.room == "" {
+			return "", errors.New("not in a room")
+		}
+		room := c.room
+		hub.Leave(c)
+		hub.Broadcast(room, fmt.Sprintf("* %s left %s", c.displayName(), room), c)
+		return "OK: left " + room, nil
+	case "rooms":
+		counts := hub.RoomCounts()
+		if len(counts) == 0 {
+			return "(no active rooms)", nil
+		}
+		var out []string
+		for room, n := range counts {
+			out = append(out, fmt.Sprintf("%s (%d)", room, n))
+		}
+		sort.Strings(out)
+		return strings.Join(out, ", "), nil
+	case "msg":
+		// /msg <user> <text>
+		if len(parts) < 3 {
+			return "", errors.New("usage: /msg <user> <text>")
+		}
+		text := strings.Join(parts[2:], " ")
+		line := fmt.Sprintf("%s [private] %s: %s", time.Now().Format(timeLayout), c.displayName(), text)
+		if !hub.SendTo(parts[1], line) {
+			return "", errors.New("user not online")
+		}
+		return fmt.Sprintf("OK: sent to %s", parts[1]), nil
+	case "addkey":
+		// /addkey <ssh-pubkey line>
+		if c.user == nil {
+			return "", errors.New("log in before adding a key")
+		}
+		if len(parts) < 2 {
+			return "", errors.New("usage: /addkey <ssh-pubkey line>")
+		}
+		keyLine := strings.Join(parts[1:], " ")
+		_, fingerprint, err := parseAuthorizedKey(keyLine)
+		if err != nil {
+			return "", fmt.Errorf("invalid public key: %w", err)
+		}
+		k := PubKey{UserID: c.user.ID, Fingerprint: fingerprint, KeyLine: keyLine}
+		if err := db.Create(&k).Error; err != nil {
+			return "", err
+		}
+		return "OK: added key " + fingerprint, nil
+	case "pubkeyauth":
+		// /pubkeyauth <name>
+		if len(parts) != 2 {
+			return "", errors.New("usage: /pubkeyauth <name>")
+		}
+		return beginPubkeyAuth(c, parts[1])
+	case "authresp":
+		// /authresp <format> <base64-signature-blob>
+		if len(parts) != 3 {
+			return "", errors.New("usage: /authresp <format> <signature>")
+		}
+		host, _, _ := net.SplitHostPort(c.remote)
+		u, err := finishPubkeyAuth(c, parts[1], parts[2])
+		if err != nil {
+			recordAuthFailure(hub, host)
+			return "", err
+		}
+		if banCache.Banned("name", u.Name) || banCache.Banned("userid", strconv.FormatUint(uint64(u.ID), 10)) {
+			recordAuthFailure(hub, host)
+			return "", errors.New("this account is banned")
+		}
+		var keys []PubKey
+		db.Where("user_id = ?", u.ID).Find(&keys)
+		permitted := allowed.allows(u.Name, "")
+		for _, k := range keys {
+			if allowed.allows("", k.Fingerprint) {
+				permitted = true
+			}
+		}
+		if !permitted {
+			recordAuthFailure(hub, host)
+			return "", errors.New("not on the whitelist")
+		}
+		rateLimiter.authSuccess(host)
+		hub.BindUser(c, u)
+		return "OK: logged in as " + u.Name, nil
+	case "ban":
+		// /ban <name|ip|userid> <value> <duration|permanent> [reason...]
+		if err := requireAdmin(c); err != nil {
+			return "", err
+		}
+		if len(parts) < 4 {
+			return "", errors.New("usage: /ban <name|ip|userid> <value> <duration|permanent> [reason]")
+		}
+		kind, value := parts[1], parts[2]
+		if !banKinds[kind] {
+			return "", errors.New("ban type must be name, ip or userid")
+		}
+		until, err := parseBanUntil(parts[3])
+		if err != nil {
+			return "", err
+		}
+		reason := ""
+		if len(parts) > 4 {
+			reason = strings.Join(parts[4:], " ")
+		}
+		b := Ban{Type: kind, Value: value, Until: until, Reason: reason, CreatedAt: time.Now()}
+		if err := db.Create(&b).Error; err != nil {
+			return "", err
+		}
+		if err := banCache.Reload(); err != nil {
+			fmt.Println("ban cache reload error:", err)
+		}
+		for _, target := range hub.MatchingClients(kind, value) {
+			target.conn.Close()
+		}
+		return fmt.Sprintf("OK: banned %s %s", kind, value), nil
+	case "unban":
+		// /unban <name|ip|userid> <value>
+		if err := requireAdmin(c); err != nil {
+			return "", err
+		}
+		if len(parts) != 3 {
+			return "", errors.New("usage: /unban <name|ip|userid> <value>")
+		}
+		kind, value := parts[1], parts[2]
+		if err := db.Where("type = ? AND value = ?", kind, value).Delete(&Ban{}).Error; err != nil {
+			return "", err
+		}
+		if err := banCache.Reload(); err != nil {
+			fmt.Println("ban cache reload error:", err)
+		}
+		return fmt.Sprintf("OK: unbanned %s %s", kind, value), nil
+	case "kick":
+		// /kick <name>
+		if err := requireAdmin(c); err != nil {
+			return "", err
+		}
+		if len(parts) != 2 {
+			return "", errors.New("usage: /kick <name>")
+		}
+		target, ok := hub.FindByName(parts[1])
+		if !ok {
+			return "", errors.New("user not online")
+		}
+		target.conn.Close()
+		return "OK: kicked " + parts[1], nil
+	case "banlist":
+		if err := requireAdmin(c); err != nil {
+			return "", err
+		}
+		var bans []Ban
+		if err := db.Find(&bans).Error; err != nil {
+			return "", err
+		}
+		var out []string
+		for _, b := range bans {
+			if b.expired() {
+				continue
+			}
+			out = append(out, formatBan(b))
+		}
+		if len(out) == 0 {
+			return "(no bans)", nil
+		}
+		return strings.Join(out, "; "), nil
 	default:
 		return "", errors.New("unknown command: " + cmd)
 	}
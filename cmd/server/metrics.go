@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+var (
+	connectedClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "chat_connected_clients",
+		Help: "Number of currently connected client sockets.",
+	})
+	messagesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_total",
+		Help: "Total number of chat messages broadcast to a room.",
+	})
+	commandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_commands_total",
+		Help: "Total number of commands handled, by command name.",
+	}, []string{"name"})
+	authFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_auth_failures_total",
+		Help: "Total number of failed login/auth attempts.",
+	})
+	dbWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chat_db_write_duration_seconds",
+		Help:    "Latency of db.Create(&Message{}) calls.",
+		Buckets: prometheus.DefBuckets,
+	})
+	dbQueryErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_db_query_errors_total",
+		Help: "Total number of GORM Query-phase calls that returned an error other than record-not-found.",
+	})
+)
+
+// registerGormMetrics hooks a callback into db's Query phase that counts
+// failed queries. ErrRecordNotFound is not counted, and create, update and
+// delete errors are not seen by this callback.
+func registerGormMetrics(db *gorm.DB) error {
+	return db.Callback().Query().After("gorm:query").Register("metrics:count_query_errors", func(tx *gorm.DB) {
+		if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+			dbQueryErrorsTotal.Inc()
+		}
+	})
+}
+
+// serveMetrics starts the optional HTTP admin listener exposing Prometheus
+// metrics and pprof profiles. It runs until the process exits or the
+// listener fails.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	fmt.Println("Serving metrics and pprof on", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Println("metrics server error:", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// nonceSize is the number of random bytes sent as an /pubkeyauth challenge.
+const nonceSize = 32
+
+// PubKey is an SSH public key a user has registered via /addkey, stored in
+// authorized_keys line form alongside its fingerprint for fast lookup.
+type PubKey struct {
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint `gorm:"index"`
+	Fingerprint string `gorm:"uniqueIndex"`
+	KeyLine     string
+}
+
+// parseAuthorizedKey is a thin wrapper returning just the key and its
+// fingerprint for an authorized_keys-style line.
+func parseAuthorizedKey(line string) (ssh.PublicKey, string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, "", err
+	}
+	return pub, ssh.FingerprintSHA256(pub), nil
+}
+
+// whitelist holds the optional set of names/fingerprints permitted to log
+// in, loaded from -whitelist. A nil whitelist means everyone is allowed.
+type whitelist map[string]bool
+
+func loadWhitelist(path string) (whitelist, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wl := make(whitelist)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		wl[entry] = true
+	}
+	return wl, scanner.Err()
+}
+
+// allows reports whether name or fingerprint is permitted. An empty/nil
+// whitelist allows everyone.
+func (wl whitelist) allows(name, fingerprint string) bool {
+	if len(wl) == 0 {
+		return true
+	}
+	return wl[name] || wl[fingerprint]
+}
+
+// beginPubkeyAuth looks up the user's registered keys and, if any exist,
+// issues a nonce challenge for the client to sign.
+func beginPubkeyAuth(c *Client, name string) (string, error) {
+	var u User
+	if err := db.Where("name = ?", name).First(&u).Error; err != nil {
+		return "", fmt.Errorf("no such user")
+	}
+	var keys []PubKey
+	if err := db.Where("user_id = ?", u.ID).Find(&keys).Error; err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no keys registered for %s", name)
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	c.pendingAuthName = name
+	c.pendingNonce = nonce
+	return "AUTH " + base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// finishPubkeyAuth verifies a signature produced over the nonce issued by
+// beginPubkeyAuth against every key registered to the pending user.
+func finishPubkeyAuth(c *Client, format, blobB64 string) (*User, error) {
+	if c.pendingNonce == nil {
+		return nil, fmt.Errorf("no pending auth challenge, run /pubkeyauth <name> first")
+	}
+	blob, err := base64.StdEncoding.DecodeString(blobB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding")
+	}
+	sig := &ssh.Signature{Format: format, Blob: blob}
+
+	var u User
+	if err := db.Where("name = ?", c.pendingAuthName).First(&u).Error; err != nil {
+		return nil, fmt.Errorf("no such user")
+	}
+	var keys []PubKey
+	if err := db.Where("user_id = ?", u.ID).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	nonce := c.pendingNonce
+	c.pendingNonce = nil
+	c.pendingAuthName = ""
+
+	for _, k := range keys {
+		pub, _, err := parseAuthorizedKey(k.KeyLine)
+		if err != nil {
+			continue
+		}
+		if pub.Verify(nonce, sig) == nil {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("signature verification failed")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// connLimiter enforces a per-IP cap on concurrent connections and hands out
+// per-connection token-bucket limiters for message throttling. It also
+// tracks consecutive auth failures per IP, escalating to a temporary ban
+// once the configured threshold is crossed.
+type connLimiter struct {
+	maxConnsPerIP int
+	msgRate       rate.Limit
+	msgBurst      int
+	maxAuthFails  int
+	authBanFor    time.Duration
+
+	mu        sync.Mutex
+	conns     map[string]int
+	authFails map[string]int
+}
+
+func newConnLimiter(maxConnsPerIP int, msgsPerSec float64, msgBurst int, maxAuthFails int, authBanFor time.Duration) *connLimiter {
+	return &connLimiter{
+		maxConnsPerIP: maxConnsPerIP,
+		msgRate:       rate.Limit(msgsPerSec),
+		msgBurst:      msgBurst,
+		maxAuthFails:  maxAuthFails,
+		authBanFor:    authBanFor,
+		conns:         make(map[string]int),
+		authFails:     make(map[string]int),
+	}
+}
+
+// acquire reserves a connection slot for host, reporting false if host is
+// already at its concurrent-connection cap. A non-positive maxConnsPerIP
+// disables the cap.
+func (l *connLimiter) acquire(host string) bool {
+	if l.maxConnsPerIP <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[host] >= l.maxConnsPerIP {
+		return false
+	}
+	l.conns[host]++
+	return true
+}
+
+// release frees the connection slot a prior acquire reserved for host.
+func (l *connLimiter) release(host string) {
+	if l.maxConnsPerIP <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns[host]--
+	if l.conns[host] <= 0 {
+		delete(l.conns, host)
+	}
+}
+
+// newMessageLimiter returns a fresh per-connection token bucket sized
+// according to the configured message rate and burst.
+func (l *connLimiter) newMessageLimiter() *rate.Limiter {
+	return rate.NewLimiter(l.msgRate, l.msgBurst)
+}
+
+// authFailure records a failed /connect or /authresp attempt from host and
+// reports whether it just crossed the ban threshold. A non-positive
+// maxAuthFails disables the escalation.
+func (l *connLimiter) authFailure(host string) bool {
+	if host == "" || l.maxAuthFails <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.authFails[host]++
+	if l.authFails[host] >= l.maxAuthFails {
+		delete(l.authFails, host)
+		return true
+	}
+	return false
+}
+
+// authSuccess clears host's failed-auth counter after a successful login.
+func (l *connLimiter) authSuccess(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.authFails, host)
+}
+
+// recordAuthFailure increments the auth-failure metric and, once host has
+// failed enough times in a row, bans it for rateLimiter.authBanFor.
+func recordAuthFailure(hub *Hub, host string) {
+	authFailuresTotal.Inc()
+	if rateLimiter.authFailure(host) {
+		if err := banIP(hub, host, rateLimiter.authBanFor, "automatic: repeated auth failures"); err != nil {
+			fmt.Println("auto ban error:", err)
+		}
+	}
+}
+
+// banIP inserts a temporary (or, with dur <= 0, permanent) IP ban and
+// immediately disconnects any matching connected clients.
+func banIP(hub *Hub, host string, dur time.Duration, reason string) error {
+	until := time.Time{}
+	if dur > 0 {
+		until = time.Now().Add(dur)
+	}
+	b := Ban{Type: "ip", Value: host, Until: until, Reason: reason, CreatedAt: time.Now()}
+	if err := db.Create(&b).Error; err != nil {
+		return err
+	}
+	if err := banCache.Reload(); err != nil {
+		return err
+	}
+	for _, target := range hub.MatchingClients("ip", host) {
+		target.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package proto implements the server's framed wire protocol: every frame
+// is a 4-byte big-endian length prefix followed by a JSON-encoded Frame.
+// It replaces the original newline-delimited protocol, which silently
+// truncated lines over 64KiB and had no way to distinguish a server reply
+// from a broadcast event or an error.
+package proto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxFrameSize bounds how large a single frame's JSON body may be, so a
+// peer can't force an unbounded allocation with a bogus length prefix.
+const maxFrameSize = 1 << 20 // 1 MiB
+
+// lenPrefixSize is the width of the big-endian length prefix in bytes.
+const lenPrefixSize = 4
+
+// Type identifies the shape of a Frame's Payload.
+type Type string
+
+const (
+	Msg   Type = "msg"   // client -> server: an ordinary chat line
+	Cmd   Type = "cmd"   // client -> server: a command invocation
+	Reply Type = "reply" // server -> client: response to a Cmd
+	Event Type = "event" // server -> client: broadcast, history or notice
+	Error Type = "error" // server -> client: a request or protocol error
+)
+
+// Frame is the top-level envelope for every message on the wire. Seq
+// correlates a Reply with the Cmd, or an Error with the Cmd or Msg, that
+// produced it; server-pushed
+// Event frames carry Seq 0.
+type Frame struct {
+	Type    Type            `json:"type"`
+	Seq     uint64          `json:"seq"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// MsgPayload is the payload of a Msg frame.
+type MsgPayload struct {
+	Text string `json:"text"`
+}
+
+// CmdPayload is the payload of a Cmd frame. Args are carried as a typed
+// array rather than a whitespace-split string, so values containing spaces
+// (e.g. passwords) survive intact.
+type CmdPayload struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// ReplyPayload is the payload of a Reply frame.
+type ReplyPayload struct {
+	Text string `json:"text"`
+}
+
+// EventPayload is the payload of an Event frame.
+type EventPayload struct {
+	Text string `json:"text"`
+}
+
+// ErrorPayload is the payload of an Error frame.
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+func newFrame(t Type, seq uint64, payload interface{}) Frame {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		// The payload types above are plain structs of strings/slices and
+		// always marshal cleanly.
+		panic(fmt.Sprintf("proto: marshal %s payload: %v", t, err))
+	}
+	return Frame{Type: t, Seq: seq, Payload: raw}
+}
+
+func NewMsg(seq uint64, text string) Frame { return newFrame(Msg, seq, MsgPayload{Text: text}) }
+
+func NewCmd(seq uint64, name string, args []string) Frame {
+	return newFrame(Cmd, seq, CmdPayload{Name: name, Args: args})
+}
+
+func NewReply(seq uint64, text string) Frame { return newFrame(Reply, seq, ReplyPayload{Text: text}) }
+
+func NewEvent(seq uint64, text string) Frame { return newFrame(Event, seq, EventPayload{Text: text}) }
+
+func NewError(seq uint64, message string) Frame {
+	return newFrame(Error, seq, ErrorPayload{Message: message})
+}
+
+// DecodeMsg unmarshals f's payload as MsgPayload. Call only on a Msg frame.
+func (f Frame) DecodeMsg() (MsgPayload, error) {
+	var p MsgPayload
+	err := json.Unmarshal(f.Payload, &p)
+	return p, err
+}
+
+// DecodeCmd unmarshals f's payload as CmdPayload. Call only on a Cmd frame.
+func (f Frame) DecodeCmd() (CmdPayload, error) {
+	var p CmdPayload
+	err := json.Unmarshal(f.Payload, &p)
+	return p, err
+}
+
+// DecodeReply unmarshals f's payload as ReplyPayload. Call only on a Reply frame.
+func (f Frame) DecodeReply() (ReplyPayload, error) {
+	var p ReplyPayload
+	err := json.Unmarshal(f.Payload, &p)
+	return p, err
+}
+
+// DecodeEvent unmarshals f's payload as EventPayload. Call only on an Event frame.
+func (f Frame) DecodeEvent() (EventPayload, error) {
+	var p EventPayload
+	err := json.Unmarshal(f.Payload, &p)
+	return p, err
+}
+
+// DecodeError unmarshals f's payload as ErrorPayload. Call only on an Error frame.
+func (f Frame) DecodeError() (ErrorPayload, error) {
+	var p ErrorPayload
+	err := json.Unmarshal(f.Payload, &p)
+	return p, err
+}
+
+// Encode returns f as a length-prefixed wire frame ready to write.
+func Encode(f Frame) ([]byte, error) {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxFrameSize {
+		return nil, fmt.Errorf("proto: frame too large (%d bytes)", len(body))
+	}
+	buf := make([]byte, lenPrefixSize+len(body))
+	binary.BigEndian.PutUint32(buf[:lenPrefixSize], uint32(len(body)))
+	copy(buf[lenPrefixSize:], body)
+	return buf, nil
+}
+
+// WriteFrame encodes f and writes it to w.
+func WriteFrame(w io.Writer, f Frame) error {
+	buf, err := Encode(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadFrame reads and decodes the next length-prefixed frame from r.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var lenBuf [lenPrefixSize]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return Frame{}, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n > maxFrameSize {
+		return Frame{}, fmt.Errorf("proto: frame too large (%d bytes)", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Frame{}, err
+	}
+	var f Frame
+	if err := json.Unmarshal(body, &f); err != nil {
+		return Frame{}, err
+	}
+	return f, nil
+}